@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vito/bass/pkg/bass"
+)
+
+func TestArgConfigs(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		arg    string
+		config string
+	}{
+		{"string default", `"world"`, `{:type :String :default "world"}`},
+		{"int default", `1`, `{:type :Int :default 1}`},
+		{"required", `:String`, `{:type :String}`},
+		{"required list", `[:String]`, `{:type [:String]}`},
+		{"list default", `["a" "b"]`, `{:type [:String] :default ["a" "b"]}`},
+		{"explicit config", `{:type [:String] :default []}`, `{:type [:String] :default []}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			scope := bass.NewStandardScope()
+			initPath := bass.NewFSPath(initSrc, bass.ParseFileOrDirPath("init.bass"))
+			if _, err := bass.EvalFSFile(ctx, scope, initPath); err != nil {
+				t.Fatal(err)
+			}
+
+			// capture the argument config from the annotated field definition
+			src := "(defobj Test (def config (:arg (:args (meta (defn f [:arg arg " + test.arg + "] => :String arg))))))"
+			if _, err := bass.EvalString(ctx, scope, src, bass.NewInMemoryFile("test.bass", src)); err != nil {
+				t.Fatal(err)
+			}
+			var obj *bass.Scope
+			if err := scope.GetDecode("Test", &obj); err != nil {
+				t.Fatal(err)
+			}
+			var actual bass.Value
+			if err := obj.GetDecode("config", &actual); err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := bass.EvalString(ctx, scope, test.config, bass.NewInMemoryFile("expected.bass", test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !actual.Equal(expected) {
+				t.Errorf("got %s, want %s", actual, expected)
+			}
+		})
+	}
+}
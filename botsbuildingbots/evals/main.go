@@ -20,6 +20,7 @@ type Evals struct {
 	Model        string
 	Attempt      int
 	SystemPrompt string
+	Seed         int
 }
 
 func New() *Evals {
@@ -43,6 +44,22 @@ func (m *Evals) WithSystemPrompt(prompt string) *Evals {
 	return m
 }
 
+// Pin the cache busters used by evals to a seed instead of the current time,
+// so that repeated runs with the same seed and attempt reuse the same results.
+func (m *Evals) WithSeed(seed int) *Evals {
+	m.Seed = seed
+	return m
+}
+
+// A value for busting the cache between attempts, which is only stable across
+// runs when a seed is set.
+func (m *Evals) buster() string {
+	if m.Seed != 0 {
+		return fmt.Sprintf("%d-seed-%d", m.Attempt, m.Seed)
+	}
+	return fmt.Sprintf("%d-%s", m.Attempt, time.Now())
+}
+
 // Test manual intervention allowing the prompt to succeed.
 func (m *Evals) LifeAlert(ctx context.Context) (*Report, error) {
 	return withLLMReport(ctx,
@@ -134,7 +151,7 @@ func (m *Evals) UndoChanges(ctx context.Context) (*Report, error) {
 			WithEnv(dag.Env().
 				WithContainerInput("ctr",
 					dag.Container().
-						WithEnvVariable("BUSTER", fmt.Sprintf("%d-%s", m.Attempt, time.Now())),
+						WithEnvVariable("BUSTER", m.buster()),
 					"A scratch container to start from.")).
 			WithPrompt("give me a minimal container for PHP 7 development").
 			Loop().
@@ -192,7 +209,7 @@ func (m *Evals) BuildMulti(ctx context.Context) (*Report, error) {
 							WithEnvVariable("GOMODCACHE", "/go/pkg/mod").
 							WithMountedCache("/go/build-cache", dag.CacheVolume("go-build")).
 							WithEnvVariable("GOCACHE", "/go/build-cache").
-							WithEnvVariable("BUSTER", fmt.Sprintf("%d-%s", m.Attempt, time.Now())),
+							WithEnvVariable("BUSTER", m.buster()),
 						"The container to use to build Booklit.").
 					WithFileOutput("bin", "The compiled Booklit binary."),
 			).
@@ -221,7 +238,7 @@ func (m *Evals) BuildMultiNoVar(ctx context.Context) (*Report, error) {
 							WithEnvVariable("GOMODCACHE", "/go/pkg/mod").
 							WithMountedCache("/go/build-cache", dag.CacheVolume("go-build")).
 							WithEnvVariable("GOCACHE", "/go/build-cache").
-							WithEnvVariable("BUSTER", fmt.Sprintf("%d-%s", m.Attempt, time.Now())),
+							WithEnvVariable("BUSTER", m.buster()),
 						"The container to use to build Booklit.").
 					WithFileOutput("bin", "The compiled Booklit binary."),
 			).
@@ -301,8 +318,10 @@ func (m *Evals) LLM() *dagger.LLM {
 }
 
 type Report struct {
-	Succeeded bool
-	Report    string
+	Succeeded    bool
+	Report       string
+	InputTokens  int
+	OutputTokens int
 }
 
 func withLLMReport(
@@ -377,8 +396,10 @@ func withLLMReport(
 	fmt.Fprintln(report, "* Output Tokens:", outputTokens)
 
 	return &Report{
-		Succeeded: succeeded,
-		Report:    report.String(),
+		Succeeded:    succeeded,
+		Report:       report.String(),
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
 	}, nil
 }
 
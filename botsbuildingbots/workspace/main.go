@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"dagger/workspace/internal/dagger"
 	"dagger/workspace/internal/telemetry"
 	_ "embed"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,8 +30,59 @@ type Workspace struct {
 	// The current system prompt.
 	SystemPrompt string
 
+	// +private
+	FewShotExamples []string
+
+	// +private
+	Replay string
+
+	// +private
+	Evals []string
+
+	// +private
+	MaxConcurrency int
+
+	// +private
+	MaxRetries int
+
+	// +private
+	BackoffBase int
+
+	// +private
+	Models []string
+
+	// +private
+	InputCostPerMToken float64
+
+	// +private
+	OutputCostPerMToken float64
+
+	// +private
+	AttemptTimeout int
+
+	// +private
+	MinSuccessRate float64
+
+	// +private
+	FailFast bool
+
+	// +private
+	PassFast bool
+
+	// +private
+	WeightedEvals []string
+
+	// +private
+	EvalWeights []float64
+
+	// +private
+	Seed int
+
 	// Observations made throughout running evaluations.
 	Findings []string
+
+	// Runs a single attempt in place of attemptOutcome, for tests.
+	outcome outcomeFunc
 }
 
 var knownModels = []string{
@@ -46,6 +104,13 @@ var evals = map[string]EvalFunc{
 	"UndoChanges":      (*dagger.Evals).UndoChanges,
 }
 
+// Groups of related evals, for running together with EvaluateCategory.
+var categories = map[string][]string{
+	"basic": {"Basic", "WorkspacePattern", "ReadImplicitVars"},
+	"build": {"BuildMulti", "BuildMultiNoVar"},
+	"state": {"UndoChanges"},
+}
+
 func New(
 	// +default=2
 	attempts int,
@@ -64,6 +129,95 @@ func (w *Workspace) WithSystemPrompt(prompt string) *Workspace {
 	return w
 }
 
+// Set example exchanges to include in the system prompt for future
+// evaluations.
+func (w *Workspace) WithFewShot(examples []string) *Workspace {
+	w.FewShotExamples = examples
+	return w
+}
+
+// Set whether evaluations call the model live, record their outcomes, or
+// replay previously recorded outcomes.
+//
+// Recordings are keyed on the eval, model, attempt, and system prompt. Replay
+// fails if a needed recording is missing.
+func (w *Workspace) WithReplay(
+	// One of "live", "record", or "replay".
+	mode string,
+) (*Workspace, error) {
+	switch mode {
+	case replayLive, replayRecord, replayReplay:
+	default:
+		return nil, fmt.Errorf("unknown replay mode: %q", mode)
+	}
+	w.Replay = mode
+	return w, nil
+}
+
+// Limit how many attempts of an evaluation run at once. Zero means no limit.
+func (w *Workspace) WithConcurrency(limit int) *Workspace {
+	w.MaxConcurrency = limit
+	return w
+}
+
+// Set how many times to retry an attempt that was rate limited.
+func (w *Workspace) WithMaxRetries(n int) *Workspace {
+	w.MaxRetries = n
+	return w
+}
+
+// Set the delay in seconds before the first retry of a rate-limited attempt,
+// which doubles with each retry. Defaults to 1 second.
+func (w *Workspace) WithBackoffBase(seconds int) *Workspace {
+	w.BackoffBase = seconds
+	return w
+}
+
+// Set the price in dollars per million prompt (input) and completion (output)
+// tokens, for estimating the cost of evaluations.
+func (w *Workspace) WithCostPerMToken(prompt, completion float64) *Workspace {
+	w.InputCostPerMToken = prompt
+	w.OutputCostPerMToken = completion
+	return w
+}
+
+// Fail any attempt that takes longer than the given number of seconds. Zero
+// means no timeout.
+func (w *Workspace) WithAttemptTimeout(seconds int) *Workspace {
+	w.AttemptTimeout = seconds
+	return w
+}
+
+// Fail evaluations whose success rate is below the given percentage, after
+// printing their report.
+func (w *Workspace) WithMinSuccessRate(percent float64) *Workspace {
+	w.MinSuccessRate = percent
+	return w
+}
+
+// Cancel the remaining attempts of an evaluation as soon as one fails.
+func (w *Workspace) WithFailFast(enabled bool) *Workspace {
+	w.FailFast = enabled
+	return w
+}
+
+// Cancel the remaining attempts of an evaluation as soon as one succeeds, to
+// find out whether a prompt can pass at all.
+func (w *Workspace) WithPassFast(enabled bool) *Workspace {
+	w.PassFast = enabled
+	return w
+}
+
+// Set a seed for reproducible evaluations. Zero means every run is fresh.
+//
+// The seed pins the cache busters used by the evals, so repeating a run with
+// the same seed, model, and system prompt reuses earlier results where it can.
+// The model itself may still not be fully deterministic.
+func (w *Workspace) WithSeed(seed int) *Workspace {
+	w.Seed = seed
+	return w
+}
+
 // Backoff sleeps for the given duration in seconds.
 //
 // Use this if you're getting rate limited and have nothing better to do.
@@ -72,21 +226,264 @@ func (w *Workspace) Backoff(seconds int) *Workspace {
 	return w
 }
 
-// The list of possible evals you can run.
+// Add an eval to the set of evals to run, instead of running every eval.
+// Adding an eval that's already in the set has no effect.
+func (w *Workspace) WithEval(name string) (*Workspace, error) {
+	if _, ok := evals[name]; !ok {
+		return nil, fmt.Errorf("unknown evaluation: %s", name)
+	}
+	if !slices.Contains(w.Evals, name) {
+		w.Evals = append(w.Evals, name)
+	}
+	return w, nil
+}
+
+// Set how much an eval counts towards the weighted score of EvaluateAll.
+// Evals have a weight of 1 by default.
+func (w *Workspace) WithEvalWeight(name string, weight float64) (*Workspace, error) {
+	if _, ok := evals[name]; !ok {
+		return nil, fmt.Errorf("unknown evaluation: %s", name)
+	}
+	w.WeightedEvals = append(w.WeightedEvals, name)
+	w.EvalWeights = append(w.EvalWeights, weight)
+	return w, nil
+}
+
+// The weight of an eval, using the most recent weight set for it.
+func (w *Workspace) evalWeight(name string) float64 {
+	weight := 1.0
+	for i, eval := range w.WeightedEvals {
+		if eval == name {
+			weight = w.EvalWeights[i]
+		}
+	}
+	return weight
+}
+
+// The list of possible evals you can run, limited to those added with WithEval
+// if any.
 func (w *Workspace) EvalNames() []string {
 	var names []string
-	for eval := range evals {
-		names = append(names, eval)
+	if len(w.Evals) > 0 {
+		names = append(names, w.Evals...)
+	} else {
+		for eval := range evals {
+			names = append(names, eval)
+		}
 	}
 	sort.Strings(names)
 	return names
 }
 
+// Set the models to evaluate against, instead of the known models.
+func (w *Workspace) WithModels(models []string) *Workspace {
+	w.Models = models
+	return w
+}
+
 // The list of models that you can run evaluations against.
 func (w *Workspace) KnownModels() []string {
 	return knownModels
 }
 
+// The models to evaluate against: those set with WithModels, or the known
+// models.
+func (w *Workspace) models() []string {
+	if len(w.Models) > 0 {
+		return w.Models
+	}
+	return knownModels
+}
+
+// Run an evaluation against each model in parallel and return all of their
+// reports.
+func (w *Workspace) EvaluateAllModelsOnce(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+) (string, error) {
+	reports, err := w.evaluateAcrossModels(ctx, name, w.models())
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(reports, "\n"), nil
+}
+
+// Run an evaluation against each model in parallel and return a CSV row of
+// model, eval, success rate, and completed attempts for each, with a header
+// row.
+//
+// The success rate and attempts are left empty for models that failed to
+// evaluate.
+func (w *Workspace) EvaluateAllModelsCSV(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+) (string, error) {
+	out := new(strings.Builder)
+	rows := csv.NewWriter(out)
+	rows.Write([]string{"model", "eval", "success_rate", "attempts"})
+	for _, result := range w.runAcrossModels(ctx, name, w.models()) {
+		rate := ""
+		if result.Err == nil {
+			rate = strconv.FormatFloat(result.Run.SuccessRate(), 'f', 4, 64)
+		}
+		attempts := ""
+		if result.Err == nil {
+			attempts = strconv.Itoa(result.Run.CompletedCount)
+		}
+		rows.Write([]string{result.Model, name, rate, attempts})
+	}
+	rows.Flush()
+	if err := rows.Error(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// The outcome of evaluating a single model.
+type modelRun struct {
+	Model string
+	Run   *evalRun
+	Err   error
+}
+
+// Run all attempts of an evaluation against each of the given models in
+// parallel.
+func (w *Workspace) runAcrossModels(ctx context.Context, name string, models []string) []modelRun {
+	results := make([]modelRun, len(models))
+	wg := new(sync.WaitGroup)
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("model: %s", model),
+				telemetry.Reveal())
+			run, err := w.runAttempts(ctx, name, model)
+			telemetry.End(span, func() error { return err })
+			results[i] = modelRun{Model: model, Run: run, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Run evaluations against two models side by side, listing the evals where
+// they disagree and comparing their overall success rates and 95% confidence
+// intervals. A winner is called out only when the intervals don't overlap.
+func (w *Workspace) CompareModels(
+	ctx context.Context,
+	// The first model to evaluate.
+	modelA string,
+	// The second model to evaluate.
+	modelB string,
+	// The evaluation to run. Runs every eval (see EvalNames) if empty.
+	// +default=""
+	eval string,
+) (string, error) {
+	names := w.EvalNames()
+	title := "all evals"
+	if eval != "" {
+		names = []string{eval}
+		title = eval
+	}
+
+	results := make([][]modelRun, len(names))
+	wg := new(sync.WaitGroup)
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("eval: %s", name),
+				telemetry.Reveal())
+			results[i] = w.runAcrossModels(ctx, name, []string{modelA, modelB})
+			telemetry.End(span, func() error {
+				return errors.Join(results[i][0].Err, results[i][1].Err)
+			})
+		}()
+	}
+	wg.Wait()
+
+	// pool the attempts of every eval for the overall comparison
+	totals := []*evalRun{{}, {}}
+	var disagreements []string
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "# Model Comparison:", title)
+	fmt.Fprintln(report)
+	fmt.Fprintf(report, "| Eval | %s | %s | |\n", modelA, modelB)
+	fmt.Fprintln(report, "| ---- | --- | --- | --- |")
+	for i, name := range names {
+		for _, result := range results[i] {
+			if result.Err != nil {
+				return "", fmt.Errorf("evaluate %s with %s: %w", name, result.Model, result.Err)
+			}
+		}
+		a, b := results[i][0].Run, results[i][1].Run
+		marker := ""
+		if passes(a) != passes(b) {
+			marker = "**DISAGREE**"
+			disagreements = append(disagreements, name)
+		}
+		fmt.Fprintf(report, "| %s | %d/%d (%.f%%) | %d/%d (%.f%%) | %s |\n", name,
+			a.SuccessCount, a.CompletedCount, a.SuccessRate()*100,
+			b.SuccessCount, b.CompletedCount, b.SuccessRate()*100, marker)
+		for m, run := range []*evalRun{a, b} {
+			totals[m].SuccessCount += run.SuccessCount
+			totals[m].CompletedCount += run.CompletedCount
+		}
+	}
+	fmt.Fprintln(report)
+
+	fmt.Fprintln(report, "## Disagreements")
+	fmt.Fprintln(report)
+	if len(disagreements) == 0 {
+		fmt.Fprintln(report, "None: both models passed and failed the same evals.")
+	}
+	for i, name := range names {
+		if !slices.Contains(disagreements, name) {
+			continue
+		}
+		winner, loser := results[i][0], results[i][1]
+		if !passes(winner.Run) {
+			winner, loser = loser, winner
+		}
+		fmt.Fprintf(report, "- %s: %s passed %d/%d, %s passed %d/%d\n", name,
+			winner.Model, winner.Run.SuccessCount, winner.Run.CompletedCount,
+			loser.Model, loser.Run.SuccessCount, loser.Run.CompletedCount)
+	}
+	fmt.Fprintln(report)
+
+	fmt.Fprintln(report, "## Overall")
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "| Model | Success Rate | 95% Confidence Interval |")
+	fmt.Fprintln(report, "| ----- | ------------ | ----------------------- |")
+	for m, model := range []string{modelA, modelB} {
+		low, high := totals[m].WilsonInterval()
+		fmt.Fprintf(report, "| %s | %d/%d (%.f%%) | %.f%% - %.f%% |\n", model,
+			totals[m].SuccessCount, totals[m].CompletedCount, totals[m].SuccessRate()*100,
+			low*100, high*100)
+	}
+	fmt.Fprintln(report)
+
+	lowA, highA := totals[0].WilsonInterval()
+	lowB, highB := totals[1].WilsonInterval()
+	switch {
+	case lowA > highB:
+		fmt.Fprintf(report, "VERDICT: %s does better than %s\n", modelA, modelB)
+	case lowB > highA:
+		fmt.Fprintf(report, "VERDICT: %s does better than %s\n", modelB, modelA)
+	default:
+		fmt.Fprintln(report, "VERDICT: no significant difference; try more attempts")
+	}
+	return report.String(), nil
+}
+
+// Whether a model passed an eval, meaning most of its completed attempts
+// succeeded.
+func passes(run *evalRun) bool {
+	return run.CompletedCount > 0 && 2*run.SuccessCount > run.CompletedCount
+}
+
 // Record an interesting finding after performing evaluations.
 func (w *Workspace) WithFinding(finding string) *Workspace {
 	w.Findings = append(w.Findings, finding)
@@ -102,18 +499,941 @@ func (w *Workspace) Evaluate(
 	// +default=""
 	model string,
 ) (_ string, rerr error) {
+	run, err := w.runAttempts(ctx, name, model)
+	if err != nil {
+		return "", err
+	}
+	report := w.report(model, run)
+	if err := w.checkSuccessRate(run.SuccessRate(), report); err != nil {
+		return "", err
+	}
+	return report, nil
+}
+
+// Return an error if a success rate (from 0 to 1) is below the minimum success
+// rate, printing the report so that it isn't lost.
+func (w *Workspace) checkSuccessRate(rate float64, report string) error {
+	if rate*100 >= w.MinSuccessRate {
+		return nil
+	}
+	fmt.Print(report)
+	return fmt.Errorf("success rate %.f%% below threshold %.f%%", rate*100, w.MinSuccessRate)
+}
+
+// Run an evaluation and return its results as JSON.
+func (w *Workspace) EvaluateJSON(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+	// The model to evaluate.
+	// +default=""
+	model string,
+) (string, error) {
+	run, err := w.runAttempts(ctx, name, model)
+	if err != nil {
+		return "", err
+	}
+	result, err := json.Marshal(w.result(name, model, run))
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// Run an evaluation and return a directory containing its markdown report
+// (report.md), a JSON summary (summary.json), and the report of each attempt
+// (attempt-N.md).
+func (w *Workspace) EvaluateToDir(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+	// The model to evaluate.
+	// +default=""
+	model string,
+) (*dagger.Directory, error) {
+	run, err := w.runAttempts(ctx, name, model)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := json.MarshalIndent(w.result(name, model, run), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	dir := dag.Directory().
+		WithNewFile("report.md", w.report(model, run)).
+		WithNewFile("summary.json", string(summary)+"\n")
+	for attempt, report := range run.Reports {
+		status := "FAILED"
+		if !run.Completed[attempt] {
+			status = "SKIPPED"
+		} else if run.Succeeded[attempt] {
+			status = "SUCCEEDED"
+		}
+		dir = dir.WithNewFile(fmt.Sprintf("attempt-%d.md", attempt+1),
+			fmt.Sprintf("# Attempt %d: %s\n\n%s\n", attempt+1, status, report))
+	}
+	return dir, nil
+}
+
+// Summarize the results of an evaluation for machines.
+func (w *Workspace) result(name, model string, run *evalRun) evalResult {
+	low, high := run.WilsonInterval()
+	return evalResult{
+		Eval:         name,
+		Model:        model,
+		Attempts:     w.Attempts,
+		Completed:    run.CompletedCount,
+		Succeeded:    run.Succeeded,
+		SuccessCount: run.SuccessCount,
+		SuccessRate:  run.SuccessRate(),
+		InputTokens:  run.InputTokens,
+		OutputTokens: run.OutputTokens,
+		Cost:         w.cost(run),
+		Variance:     run.Variance(),
+		WilsonLow:    low,
+		WilsonHigh:   high,
+	}
+}
+
+// The machine-readable results of an evaluation.
+type evalResult struct {
+	Eval         string  `json:"eval"`
+	Model        string  `json:"model"`
+	Attempts     int     `json:"attempts"`
+	Completed    int     `json:"completed"`
+	Succeeded    []bool  `json:"succeeded"`
+	SuccessCount int     `json:"successCount"`
+	SuccessRate  float64 `json:"successRate"`
+	InputTokens  []int   `json:"inputTokens"`
+	OutputTokens []int   `json:"outputTokens"`
+	Cost         float64 `json:"cost"`
+	Variance     float64 `json:"variance"`
+	WilsonLow    float64 `json:"wilsonLow"`
+	WilsonHigh   float64 `json:"wilsonHigh"`
+}
+
+// Render the full report for all attempts of an evaluation.
+func (w *Workspace) report(model string, run *evalRun) string {
+	finalReport := new(strings.Builder)
+	fmt.Fprintln(finalReport, "# Model:", model)
+	fmt.Fprintln(finalReport)
+	fmt.Fprintln(finalReport, "Few-shot examples:", len(w.FewShotExamples))
+	fmt.Fprintln(finalReport)
+	fmt.Fprintln(finalReport, "## All Attempts")
+	fmt.Fprintln(finalReport)
+	for _, report := range run.Reports {
+		fmt.Fprint(finalReport, report)
+	}
+
+	fmt.Fprintln(finalReport, "## Final Report")
+	fmt.Fprintln(finalReport)
+	if run.StoppedEarly != "" {
+		fmt.Fprintf(finalReport, "STOPPED EARLY: %s, so the remaining attempts were cancelled.\n", run.StoppedEarly)
+		fmt.Fprintln(finalReport)
+	}
+	fmt.Fprintf(finalReport, "SUCCESS RATE: %d/%d (%.f%%)", run.SuccessCount, run.CompletedCount, run.SuccessRate()*100)
+	if skipped := run.Skipped(); skipped > 0 {
+		fmt.Fprintf(finalReport, ", %d skipped", skipped)
+	}
+	fmt.Fprintln(finalReport)
+	low, high := run.WilsonInterval()
+	fmt.Fprintf(finalReport, "95%% CONFIDENCE INTERVAL: %.f%% - %.f%% (variance %.3f)\n", low*100, high*100, run.Variance())
+	fmt.Fprintln(finalReport)
+	fmt.Fprintln(finalReport, "* Input Tokens:", run.TotalInputTokens())
+	fmt.Fprintln(finalReport, "* Output Tokens:", run.TotalOutputTokens())
+	fmt.Fprintf(finalReport, "* Estimated Cost: $%.4f\n", w.cost(run))
+
+	return finalReport.String()
+}
+
+// Estimate the cost of an evaluation's attempts in dollars.
+func (w *Workspace) cost(run *evalRun) float64 {
+	return (float64(run.TotalInputTokens())*w.InputCostPerMToken +
+		float64(run.TotalOutputTokens())*w.OutputCostPerMToken) / 1e6
+}
+
+// Run an evaluation and record its success rate in the eval history under the
+// given source revision.
+func (w *Workspace) EvaluateWithRevision(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+	// The source revision (e.g. a git commit) to record the results under.
+	revision string,
+	// The model to evaluate.
+	// +default=""
+	model string,
+) (string, error) {
+	run, err := w.runAttempts(ctx, name, model)
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := json.Marshal(historyEntry{
+		Revision:  revision,
+		Model:     model,
+		Successes: run.SuccessCount,
+		Attempts:  run.CompletedCount,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = historyContainer().
+		WithExec([]string{"sh", "-c", `echo "$1" >> "$0"`, historyPath(name), string(entry)}).
+		Sync(ctx)
+	if err != nil {
+		return "", fmt.Errorf("record history: %w", err)
+	}
+
+	return fmt.Sprintf("Revision: %s\n\n%s", revision, w.report(model, run)), nil
+}
+
+// Show the success rate of an evaluation for each recorded source revision and
+// model.
+func (w *Workspace) History(
+	ctx context.Context,
+	// The evaluation to show history for.
+	name string,
+) (string, error) {
+	out, err := historyContainer().
+		WithExec([]string{"sh", "-c", `cat "$0" 2>/dev/null || true`, historyPath(name)}).
+		Stdout(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	type revisionKey struct {
+		Revision string
+		Model    string
+	}
+	type revisionStats struct {
+		Runs      int
+		Successes int
+		Attempts  int
+		LastRun   time.Time
+	}
+	var revisions []revisionKey
+	stats := map[revisionKey]*revisionStats{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry historyEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return "", fmt.Errorf("parse history entry %q: %w", line, err)
+		}
+		key := revisionKey{Revision: entry.Revision, Model: entry.Model}
+		s, ok := stats[key]
+		if !ok {
+			s = &revisionStats{}
+			stats[key] = s
+			revisions = append(revisions, key)
+		}
+		s.Runs++
+		s.Successes += entry.Successes
+		s.Attempts += entry.Attempts
+		s.LastRun = entry.Time
+	}
+
+	if len(revisions) == 0 {
+		return fmt.Sprintf("No history recorded for %s.\n", name), nil
+	}
+
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "# History:", name)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "| Revision | Model | Runs | Success Rate | Last Run |")
+	fmt.Fprintln(report, "| -------- | ----- | ---- | ------------ | -------- |")
+	for _, key := range revisions {
+		s := stats[key]
+		var rate float64
+		if s.Attempts > 0 {
+			rate = float64(s.Successes) / float64(s.Attempts)
+		}
+		fmt.Fprintf(report, "| %s | %s | %d | %d/%d (%.f%%) | %s |\n", key.Revision, key.Model, s.Runs,
+			s.Successes, s.Attempts, rate*100, s.LastRun.Format(time.RFC3339))
+	}
+	return report.String(), nil
+}
+
+// A single evaluation run recorded in the eval history.
+type historyEntry struct {
+	Revision  string    `json:"revision"`
+	Model     string    `json:"model"`
+	Successes int       `json:"successes"`
+	Attempts  int       `json:"attempts"`
+	Time      time.Time `json:"time"`
+}
+
+const historyDir = "/history"
+
+// The path to the history file for an evaluation.
+func historyPath(name string) string {
+	return path.Join(historyDir, name+".jsonl")
+}
+
+// A container with the eval history mounted, busted so that it always sees the
+// latest history.
+func historyContainer() *dagger.Container {
+	return dag.Container().
+		From("alpine").
+		WithMountedCache(historyDir, dag.CacheVolume("workspace-eval-history")).
+		WithEnvVariable("NOW", time.Now().String())
+}
+
+// The categories of evals you can run with EvaluateCategory.
+func (w *Workspace) EvalCategories() []string {
+	var names []string
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run every eval and report their success rates along with the overall
+// success rate and a score weighted by each eval's weight.
+func (w *Workspace) EvaluateAll(
+	ctx context.Context,
+	// The model to evaluate.
+	// +default=""
+	model string,
+) (string, error) {
+	return w.evaluateEvals(ctx, "All Evals", w.EvalNames(), model)
+}
+
+// Run every eval in a category and report their success rates along with the
+// overall success rate and a score weighted by each eval's weight.
+func (w *Workspace) EvaluateCategory(
+	ctx context.Context,
+	// The category of evals to run (see EvalCategories).
+	category string,
+	// The model to evaluate.
+	// +default=""
+	model string,
+) (string, error) {
+	names, ok := categories[category]
+	if !ok {
+		return "", fmt.Errorf("unknown category: %s", category)
+	}
+	return w.evaluateEvals(ctx, fmt.Sprintf("Category: %s", category), names, model)
+}
+
+// Run the given evals in parallel and report on them together under a title.
+func (w *Workspace) evaluateEvals(ctx context.Context, title string, names []string, model string) (string, error) {
+	type evalOutcome struct {
+		Name string
+		Run  *evalRun
+		Err  error
+	}
+
+	results := make([]evalOutcome, len(names))
+	wg := new(sync.WaitGroup)
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("eval: %s", name),
+				telemetry.Reveal())
+			run, err := w.runAttempts(ctx, name, model)
+			telemetry.End(span, func() error { return err })
+			results[i] = evalOutcome{Name: name, Run: run, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	var successes, attempts int
+	var weightedScore, totalWeight float64
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "#", title)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "Model:", model)
+	fmt.Fprintln(report, "Attempts per eval:", w.Attempts)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "| Eval | Weight | Success Rate |")
+	fmt.Fprintln(report, "| ---- | ------ | ------------ |")
+	for _, result := range results {
+		weight := w.evalWeight(result.Name)
+		if result.Err != nil {
+			fmt.Fprintf(report, "| %s | %g | ERROR: %s |\n", result.Name, weight, result.Err)
+			continue
+		}
+		successes += result.Run.SuccessCount
+		attempts += result.Run.CompletedCount
+		weightedScore += weight * result.Run.SuccessRate()
+		totalWeight += weight
+		fmt.Fprintf(report, "| %s | %g | %d/%d (%.f%%) |\n", result.Name, weight,
+			result.Run.SuccessCount, result.Run.CompletedCount, result.Run.SuccessRate()*100)
+	}
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "## Final Report")
+	fmt.Fprintln(report)
+	var rate float64
+	if attempts > 0 {
+		rate = float64(successes) / float64(attempts)
+		fmt.Fprintf(report, "SUCCESS RATE: %d/%d (%.f%%)\n", successes, attempts, rate*100)
+		if totalWeight > 0 {
+			fmt.Fprintf(report, "WEIGHTED SCORE: %.f%%\n", weightedScore/totalWeight*100)
+		}
+	} else {
+		fmt.Fprintln(report, "SUCCESS RATE: no evals completed")
+	}
+
+	if err := w.checkSuccessRate(rate, report.String()); err != nil {
+		return "", err
+	}
+	return report.String(), nil
+}
+
+// Run every eval repeatedly and rank them by how inconsistent their outcomes
+// are across identical attempts.
+func (w *Workspace) DetectFlakiness(
+	ctx context.Context,
+	// The model to evaluate.
+	// +default=""
+	model string,
+) (string, error) {
+	if w.Attempts < 2 {
+		return "", fmt.Errorf("detecting flakiness requires at least 2 attempts, have %d", w.Attempts)
+	}
+
+	type flakiness struct {
+		Name  string
+		Run   *evalRun
+		Score float64
+		Err   error
+	}
+
+	names := w.EvalNames()
+	results := make([]flakiness, len(names))
+	wg := new(sync.WaitGroup)
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("eval: %s", name),
+				telemetry.Reveal())
+			run, err := w.runAttempts(ctx, name, model)
+			telemetry.End(span, func() error { return err })
+			results[i] = flakiness{Name: name, Run: run, Err: err}
+			if err == nil {
+				results[i].Score = run.Flakiness()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "# Flakiness Report")
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "Model:", model)
+	fmt.Fprintln(report, "Attempts per eval:", w.Attempts)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "| Eval | Passed | Flakiness | Flaky? |")
+	fmt.Fprintln(report, "| ---- | ------ | --------- | ------ |")
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(report, "| %s | ERROR: %s | - | - |\n", result.Name, result.Err)
+			continue
+		}
+		flaky := "no"
+		if result.Score > 0 {
+			flaky = "YES"
+		}
+		fmt.Fprintf(report, "| %s | %d/%d | %.f%% | %s |\n",
+			result.Name, result.Run.SuccessCount, result.Run.CompletedCount, result.Score*100, flaky)
+	}
+
+	return report.String(), nil
+}
+
+// Run an evaluation against each of the given system prompts and rank them by
+// success rate.
+func (w *Workspace) PromptGrid(
+	ctx context.Context,
+	// The evaluation to run.
+	eval string,
+	// The system prompts to compare.
+	prompts []string,
+	// The model to evaluate.
+	// +default=""
+	model string,
+	// The maximum number of prompts to evaluate at once.
+	// +default=3
+	parallelism int,
+) (string, error) {
+	if _, ok := evals[eval]; !ok {
+		return "", fmt.Errorf("unknown evaluation: %s", eval)
+	}
+
+	type promptResult struct {
+		Prompt string
+		Run    *evalRun
+		Err    error
+	}
+
+	results := make([]promptResult, len(prompts))
+	sem := make(chan struct{}, max(parallelism, 1))
+	wg := new(sync.WaitGroup)
+	for i, prompt := range prompts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("prompt %d", i+1),
+				telemetry.Reveal())
+			candidate := *w
+			candidate.SystemPrompt = prompt
+			run, err := candidate.runAttempts(ctx, eval, model)
+			telemetry.End(span, func() error { return err })
+			results[i] = promptResult{Prompt: prompt, Run: run, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Err != nil || results[j].Err != nil {
+			return results[j].Err != nil && results[i].Err == nil
+		}
+		return results[i].Run.SuccessRate() > results[j].Run.SuccessRate()
+	})
+
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "# Prompt Grid:", eval)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "Model:", model)
+	fmt.Fprintln(report, "Attempts per prompt:", w.Attempts)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "| Rank | Success Rate | Prompt |")
+	fmt.Fprintln(report, "| ---- | ------------ | ------ |")
+	for i, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(report, "| %d | ERROR: %s | %s |\n", i+1, result.Err, summarize(result.Prompt))
+			continue
+		}
+		fmt.Fprintf(report, "| %d | %d/%d (%.f%%) | %s |\n", i+1,
+			result.Run.SuccessCount, result.Run.CompletedCount, result.Run.SuccessRate()*100,
+			summarize(result.Prompt))
+	}
+	if len(results) > 0 && results[0].Err == nil {
+		fmt.Fprintln(report)
+		fmt.Fprintf(report, "## Best Prompt (%.f%%)\n", results[0].Run.SuccessRate()*100)
+		fmt.Fprintln(report)
+		fmt.Fprintln(report, results[0].Prompt)
+	}
+
+	return report.String(), nil
+}
+
+// Collapse a prompt into a short single line suitable for a table cell.
+func summarize(prompt string) string {
+	const maxLen = 60
+	line := strings.Join(strings.Fields(prompt), " ")
+	if len(line) > maxLen {
+		line = line[:maxLen-3] + "..."
+	}
+	if line == "" {
+		line = "(empty)"
+	}
+	return strings.ReplaceAll(line, "|", "\\|")
+}
+
+// Run an evaluation and group its failing attempts into distinct failure
+// modes.
+func (w *Workspace) FailureModes(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+	// The model to evaluate.
+	// +default=""
+	model string,
+	// The model to use for grouping the failures.
+	// +default=""
+	analysisModel string,
+) (string, error) {
+	run, err := w.runAttempts(ctx, name, model)
+	if err != nil {
+		return "", err
+	}
+
+	failureCount := run.CompletedCount - run.SuccessCount
+
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "# Failure Modes:", name)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "Model:", model)
+	fmt.Fprintf(report, "Failed attempts: %d/%d\n", failureCount, run.CompletedCount)
+	fmt.Fprintln(report)
+
+	if failureCount < 2 {
+		fmt.Fprintln(report, "Not enough failures to cluster.")
+		return report.String(), nil
+	}
+
+	clusters, err := dag.LLM(dagger.LLMOpts{Model: analysisModel}).
+		WithPrompt(`Below are reports from failed attempts of an LLM evaluation.
+
+Group the failures into distinct failure modes based on their root cause. Respond only with a Markdown table with the columns "Failure Mode", "Count", "Attempts", and "Description", ordered by count, descending.
+
+` + run.Failures()).
+		LastReply(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cluster failures: %w", err)
+	}
+	fmt.Fprintln(report, clusters)
+
+	return report.String(), nil
+}
+
+// Iteratively improve the system prompt by running an evaluation and asking a
+// model to revise the prompt based on the failures, returning the
+// best-performing prompt along with the full evolution history.
+//
+// Stops early once a prompt succeeds on every attempt.
+func (w *Workspace) EvolvePrompt(
+	ctx context.Context,
+	// The evaluation to run.
+	name string,
+	// The maximum number of prompts to evaluate.
+	// +default=3
+	iterations int,
+	// The model to evaluate.
+	// +default=""
+	model string,
+	// The model to use for revising the prompt.
+	// +default=""
+	writerModel string,
+) (string, error) {
+	history, err := w.evolve(ctx, name, model, writerModel, iterations)
+	if err != nil {
+		return "", err
+	}
+
+	best := bestPrompt(history)
+
+	report := new(strings.Builder)
+	fmt.Fprintln(report, "# Prompt Evolution:", name)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "Model:", model)
+	fmt.Fprintln(report, "Attempts per iteration:", w.Attempts)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "| Iteration | Success Rate | Prompt |")
+	fmt.Fprintln(report, "| --------- | ------------ | ------ |")
+	for i, candidate := range history {
+		fmt.Fprintf(report, "| %d | %d/%d (%.f%%) | %s |\n", i+1,
+			candidate.Run.SuccessCount, candidate.Run.CompletedCount, candidate.Run.SuccessRate()*100,
+			summarize(candidate.Prompt))
+	}
+	fmt.Fprintln(report)
+	fmt.Fprintf(report, "## Best Prompt (%.f%%)\n", best.Run.SuccessRate()*100)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, best.Prompt)
+	fmt.Fprintln(report)
+	fmt.Fprintln(report, "## Evolution History")
+	for i, candidate := range history {
+		fmt.Fprintln(report)
+		fmt.Fprintf(report, "### Iteration %d (%.f%%)\n", i+1, candidate.Run.SuccessRate()*100)
+		fmt.Fprintln(report)
+		fmt.Fprintln(report, candidate.Prompt)
+	}
+
+	return report.String(), nil
+}
+
+// Return the system prompt with the highest success rate on an evaluation, for
+// use elsewhere. With more than one round, the prompt is revised between
+// rounds as in Optimize, which also reports the score of each round.
+func (w *Workspace) BestPrompt(
+	ctx context.Context,
+	// The evaluation to run.
+	eval string,
+	// The maximum number of rounds to run.
+	// +default=1
+	rounds int,
+	// The model to evaluate and revise the prompt with.
+	// +default=""
+	model string,
+) (string, error) {
+	history, err := w.evolve(ctx, eval, model, model, rounds)
+	if err != nil {
+		return "", err
+	}
+	return bestPrompt(history).Prompt, nil
+}
+
+// Repeatedly run an evaluation and have the evaluated model revise the system
+// prompt based on its failures, printing the score of each round. The system
+// prompt is set to the best-scoring one for future evaluations.
+func (w *Workspace) Optimize(
+	ctx context.Context,
+	// The evaluation to run.
+	eval string,
+	// The maximum number of rounds to run.
+	// +default=3
+	rounds int,
+	// The model to evaluate and revise the prompt with.
+	// +default=""
+	model string,
+) (*Workspace, error) {
+	history, err := w.evolve(ctx, eval, model, model, rounds)
+	if err != nil {
+		return nil, err
+	}
+	for i, candidate := range history {
+		fmt.Printf("%s: round %d scored %d/%d (%.f%%)\n", eval, i+1,
+			candidate.Run.SuccessCount, candidate.Run.CompletedCount, candidate.Run.SuccessRate()*100)
+	}
+	w.SystemPrompt = bestPrompt(history).Prompt
+	return w, nil
+}
+
+// The highest-scoring prompt, preferring earlier prompts on ties.
+func bestPrompt(history []promptScore) promptScore {
+	best := history[0]
+	for _, candidate := range history[1:] {
+		if candidate.Run.SuccessRate() > best.Run.SuccessRate() {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// A system prompt and how it performed.
+type promptScore struct {
+	Prompt string
+	Run    *evalRun
+}
+
+// Evaluate and revise the system prompt until it succeeds on every attempt or
+// the iterations run out.
+func (w *Workspace) evolve(ctx context.Context, name, model, writerModel string, iterations int) ([]promptScore, error) {
+	if iterations < 1 {
+		return nil, fmt.Errorf("need at least 1 iteration, got %d", iterations)
+	}
+
+	var history []promptScore
+	prompt := w.SystemPrompt
+	for i := range iterations {
+		done, err := func() (_ bool, rerr error) {
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("iteration %d", i+1),
+				telemetry.Reveal())
+			defer telemetry.End(span, func() error { return rerr })
+
+			candidate := *w
+			candidate.SystemPrompt = prompt
+			run, err := candidate.runAttempts(ctx, name, model)
+			if err != nil {
+				return false, err
+			}
+			history = append(history, promptScore{Prompt: prompt, Run: run})
+
+			// only a prompt that ran and passed every attempt is perfect, not
+			// one whose other attempts were skipped
+			perfect := run.CompletedCount > 0 &&
+				run.CompletedCount == candidate.Attempts &&
+				run.SuccessCount == candidate.Attempts
+			if perfect || i == iterations-1 {
+				return true, nil
+			}
+
+			prompt, err = revisePrompt(ctx, writerModel, prompt, run)
+			return false, err
+		}()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+	return history, nil
+}
+
+// Ask a model to revise a system prompt based on the attempts that failed.
+func revisePrompt(ctx context.Context, writerModel string, prompt string, run *evalRun) (string, error) {
+	revised, err := dag.LLM(dagger.LLMOpts{Model: writerModel}).
+		WithPrompt(fmt.Sprintf(`You are refining the system prompt for an LLM evaluation.
+
+The current system prompt succeeded on %d of %d attempts:
+
+<system-prompt>
+%s
+</system-prompt>
+
+Here are the reports from the attempts that failed:
+
+%s
+Write an improved system prompt that addresses these failures. Respond only with the new system prompt.`,
+			run.SuccessCount, run.CompletedCount, prompt, run.Failures())).
+		LastReply(ctx)
+	if err != nil {
+		return "", fmt.Errorf("revise prompt: %w", err)
+	}
+	return strings.TrimSpace(revised), nil
+}
+
+// The outcome of every attempt of a single evaluation.
+type evalRun struct {
+	Reports      []string
+	Succeeded    []bool
+	SuccessCount int
+	InputTokens  []int
+	OutputTokens []int
+
+	// Which attempts ran to completion, as opposed to being skipped or
+	// cancelled when the evaluation stopped early.
+	Completed      []bool
+	CompletedCount int
+
+	// Why the remaining attempts were cancelled, if they were.
+	StoppedEarly string
+}
+
+// SuccessRate returns the fraction of completed attempts that succeeded.
+func (run *evalRun) SuccessRate() float64 {
+	if run.CompletedCount == 0 {
+		return 0
+	}
+	return float64(run.SuccessCount) / float64(run.CompletedCount)
+}
+
+// Skipped returns how many attempts were skipped or cancelled because the
+// evaluation stopped early.
+func (run *evalRun) Skipped() int {
+	return len(run.Completed) - run.CompletedCount
+}
+
+// TotalInputTokens returns the prompt tokens used across every attempt.
+func (run *evalRun) TotalInputTokens() int {
+	var total int
+	for _, tokens := range run.InputTokens {
+		total += tokens
+	}
+	return total
+}
+
+// TotalOutputTokens returns the completion tokens used across every attempt.
+func (run *evalRun) TotalOutputTokens() int {
+	var total int
+	for _, tokens := range run.OutputTokens {
+		total += tokens
+	}
+	return total
+}
+
+// Variance returns the variance of the completed attempts' outcomes, counting
+// successes as 1 and failures as 0.
+func (run *evalRun) Variance() float64 {
+	p := run.SuccessRate()
+	return p * (1 - p)
+}
+
+// WilsonInterval returns the 95% Wilson score interval for the success rate,
+// which stays meaningful for small numbers of attempts.
+func (run *evalRun) WilsonInterval() (low, high float64) {
+	const z = 1.96
+	n := float64(run.CompletedCount)
+	if n == 0 {
+		return 0, 1
+	}
+	p := run.SuccessRate()
+	center := (p + z*z/(2*n)) / (1 + z*z/n)
+	margin := z / (1 + z*z/n) * math.Sqrt(p*(1-p)/n+z*z/(4*n*n))
+	return max(center-margin, 0), min(center+margin, 1)
+}
+
+// Flakiness returns 0 when every completed attempt had the same outcome and 1
+// when they were evenly split between passing and failing.
+func (run *evalRun) Flakiness() float64 {
+	if run.CompletedCount == 0 {
+		return 0
+	}
+	failures := run.CompletedCount - run.SuccessCount
+	return float64(2*min(run.SuccessCount, failures)) / float64(run.CompletedCount)
+}
+
+// Failures renders the reports of every completed attempt that failed.
+func (run *evalRun) Failures() string {
+	failures := new(strings.Builder)
+	for attempt, succeeded := range run.Succeeded {
+		if run.Completed[attempt] && !succeeded {
+			fmt.Fprintf(failures, "<attempt number=\"%d\">\n%s\n</attempt>\n\n", attempt+1, run.Reports[attempt])
+		}
+	}
+	return failures.String()
+}
+
+// Run all attempts of an evaluation in parallel, up to the concurrency limit.
+func (w *Workspace) runAttempts(ctx context.Context, name, model string) (*evalRun, error) {
 	evalFn, ok := evals[name]
 	if !ok {
-		return "", fmt.Errorf("unknown evaluation: %s", name)
+		return nil, fmt.Errorf("unknown evaluation: %s", name)
+	}
+
+	run := &evalRun{
+		Reports:      make([]string, w.Attempts),
+		Succeeded:    make([]bool, w.Attempts),
+		InputTokens:  make([]int, w.Attempts),
+		OutputTokens: make([]int, w.Attempts),
+		Completed:    make([]bool, w.Attempts),
+	}
+	// missing recordings fail the whole run, rather than counting as failures
+	missing := make([]error, w.Attempts)
+	limit := w.MaxConcurrency
+	if limit <= 0 {
+		limit = max(w.Attempts, 1)
+	}
+	sem := make(chan struct{}, limit)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stopOnce sync.Once
+	stopEarly := func(reason string) {
+		stopOnce.Do(func() {
+			run.StoppedEarly = reason
+			cancel()
+		})
+	}
+
+	// log progress as each attempt finishes, since runs can take a while
+	var progressMu sync.Mutex
+	var finished, passed int
+	logProgress := func(attempt int) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		if !run.Completed[attempt] {
+			fmt.Printf("%s: attempt %d cancelled\n", name, attempt+1)
+			return
+		}
+		finished++
+		result := "failed"
+		if run.Succeeded[attempt] {
+			passed++
+			result = "succeeded"
+		}
+		fmt.Printf("%s: attempt %d %s (%d/%d succeeded so far, %d/%d finished)\n",
+			name, attempt+1, result, passed, finished, finished, w.Attempts)
 	}
 
-	reports := make([]string, w.Attempts)
 	wg := new(sync.WaitGroup)
-	var successCount int
 	for attempt := range w.Attempts {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				run.Reports[attempt] = fmt.Sprintf("## Attempt %d\n\nSkipped: evaluation stopped early.\n\n", attempt+1)
+				return
+			}
+			defer logProgress(attempt)
 
 			report := new(strings.Builder)
 
@@ -125,54 +1445,220 @@ func (w *Workspace) Evaluate(
 			defer stdio.Close()
 
 			defer func() {
-				reports[attempt] = report.String()
+				run.Reports[attempt] = report.String()
 				fmt.Fprint(stdio.Stdout, report.String())
 			}()
 
 			fmt.Fprintf(report, "## Attempt %d\n", attempt+1)
 			fmt.Fprintln(report)
 
-			eval := w.evaluate(model, attempt, evalFn)
+			attemptCtx := ctx
+			if w.AttemptTimeout > 0 {
+				var cancel context.CancelFunc
+				attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(w.AttemptTimeout)*time.Second)
+				defer cancel()
+			}
 
-			evalReport, err := eval.Report(ctx)
-			if err != nil {
+			outcome, err := w.runAttempt(attemptCtx, name, model, attempt, evalFn)
+			if w.AttemptTimeout > 0 && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+				rerr = fmt.Errorf("attempt timed out after %ds", w.AttemptTimeout)
+				fmt.Fprintln(report, "Evaluation timed out:", rerr)
+				fmt.Fprintln(report)
+				run.Completed[attempt] = true
+				return
+			}
+			if errors.Is(err, errNoRecording) {
 				rerr = err
+				missing[attempt] = err
+				fmt.Fprintln(report, "Replay failed:", err)
+				fmt.Fprintln(report)
 				return
 			}
-			fmt.Fprintln(report, evalReport)
-
-			succeeded, err := eval.Succeeded(ctx)
 			if err != nil {
 				rerr = err
+				if ctx.Err() != nil {
+					fmt.Fprintln(report, "Cancelled: evaluation stopped early.")
+					fmt.Fprintln(report)
+				} else {
+					run.Completed[attempt] = true
+				}
 				return
 			}
-			if succeeded {
-				successCount++
+			run.Completed[attempt] = true
+			fmt.Fprintln(report, outcome.Report)
+			run.InputTokens[attempt] = outcome.InputTokens
+			run.OutputTokens[attempt] = outcome.OutputTokens
+
+			if outcome.Succeeded {
+				run.Succeeded[attempt] = true
+				if w.PassFast {
+					stopEarly(fmt.Sprintf("attempt %d succeeded", attempt+1))
+				}
 			} else {
 				rerr = errors.New("evaluation failed")
+				if w.FailFast {
+					stopEarly(fmt.Sprintf("attempt %d failed", attempt+1))
+				}
 			}
 		}()
 	}
 
 	wg.Wait()
 
-	finalReport := new(strings.Builder)
-	fmt.Fprintln(finalReport, "# Model:", model)
-	fmt.Fprintln(finalReport)
-	fmt.Fprintln(finalReport, "## All Attempts")
-	fmt.Fprintln(finalReport)
-	for _, report := range reports {
-		fmt.Fprint(finalReport, report)
+	if err := errors.Join(missing...); err != nil {
+		return nil, err
 	}
 
-	fmt.Fprintln(finalReport, "## Final Report")
-	fmt.Fprintln(finalReport)
-	fmt.Fprintf(finalReport, "SUCCESS RATE: %d/%d (%.f%%)\n", successCount, w.Attempts, float64(successCount)/float64(w.Attempts)*100)
+	// count once every attempt is done, rather than racing to increment
+	run.SuccessCount, run.CompletedCount = tally(run.Succeeded, run.Completed)
+
+	return run, nil
+}
+
+// Count how many attempts succeeded and how many completed.
+func tally(succeeded, completed []bool) (successes, completions int) {
+	for attempt, ok := range succeeded {
+		if completed[attempt] {
+			completions++
+		}
+		if ok {
+			successes++
+		}
+	}
+	return successes, completions
+}
+
+const (
+	replayLive   = "live"
+	replayRecord = "record"
+	replayReplay = "replay"
+)
+
+// Returned when replaying an attempt that was never recorded.
+var errNoRecording = errors.New("no recording")
 
-	return finalReport.String(), nil
+// The outcome of a single attempt, as recorded for replay.
+type recording struct {
+	Report       string `json:"report"`
+	Succeeded    bool   `json:"succeeded"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
 }
 
-// Run an evaluation across all known models in parallel.
+// Runs a single attempt of an evaluation and returns its outcome.
+type outcomeFunc = func(ctx context.Context, name, model string, attempt int, evalFn EvalFunc) (*recording, error)
+
+// Run a single attempt of an evaluation, using the outcome override if set.
+func (w *Workspace) runAttempt(ctx context.Context, name, model string, attempt int, evalFn EvalFunc) (*recording, error) {
+	if w.outcome != nil {
+		return w.outcome(ctx, name, model, attempt, evalFn)
+	}
+	return w.attemptOutcome(ctx, name, model, attempt, evalFn)
+}
+
+// Run a single attempt of an evaluation, or replay it from a recording,
+// depending on the replay mode.
+func (w *Workspace) attemptOutcome(ctx context.Context, name, model string, attempt int, evalFn EvalFunc) (*recording, error) {
+	key, err := json.Marshal([]any{name, model, attempt, w.systemPrompt()})
+	if err != nil {
+		return nil, err
+	}
+	recordingPath := path.Join(recordingsDir, fmt.Sprintf("%x.json", sha256.Sum256(key)))
+
+	if w.Replay == replayReplay {
+		out, err := recordingsContainer().
+			WithExec([]string{"sh", "-c", `if [ -f "$0" ]; then cat "$0"; fi`, recordingPath}).
+			Stdout(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if out == "" {
+			return nil, fmt.Errorf("%w for %s attempt %d with model %q", errNoRecording, name, attempt+1, model)
+		}
+		var rec recording
+		if err := json.Unmarshal([]byte(out), &rec); err != nil {
+			return nil, fmt.Errorf("parse recording: %w", err)
+		}
+		return &rec, nil
+	}
+
+	rec, err := w.liveOutcome(ctx, model, attempt, evalFn)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Replay == replayRecord {
+		payload, err := json.Marshal(rec)
+		if err != nil {
+			return nil, err
+		}
+		_, err = recordingsContainer().
+			WithNewFile("/recording.json", string(payload)).
+			WithExec([]string{"cp", "/recording.json", recordingPath}).
+			Sync(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("save recording: %w", err)
+		}
+	}
+
+	return rec, nil
+}
+
+// Run a single attempt of an evaluation, retrying with exponential backoff if
+// the model rate limits it.
+func (w *Workspace) liveOutcome(ctx context.Context, model string, attempt int, evalFn EvalFunc) (*recording, error) {
+	delay := time.Duration(max(w.BackoffBase, 1)) * time.Second
+	for retry := 0; ; retry++ {
+		eval := w.evaluate(model, attempt, evalFn)
+
+		var rec recording
+		var err error
+		rec.Report, err = eval.Report(ctx)
+		if err == nil {
+			rec.Succeeded, err = eval.Succeeded(ctx)
+		}
+		if err == nil {
+			rec.InputTokens, err = eval.InputTokens(ctx)
+		}
+		if err == nil {
+			rec.OutputTokens, err = eval.OutputTokens(ctx)
+		}
+		if err == nil {
+			return &rec, nil
+		}
+		if !isRateLimited(err) || retry >= w.MaxRetries {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Whether an error looks like the model rate limited the request.
+func isRateLimited(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "429") ||
+		strings.Contains(msg, "rate limit") ||
+		strings.Contains(msg, "too many requests")
+}
+
+const recordingsDir = "/recordings"
+
+// A container with the eval recordings mounted, busted so that it always sees
+// the latest recordings.
+func recordingsContainer() *dagger.Container {
+	return dag.Container().
+		From("alpine").
+		WithMountedCache(recordingsDir, dag.CacheVolume("workspace-eval-recordings")).
+		WithEnvVariable("NOW", time.Now().String())
+}
+
+// Run an evaluation across the given models in parallel.
 func (w *Workspace) evaluateAcrossModels(
 	ctx context.Context,
 	eval string,
@@ -186,7 +1672,7 @@ func (w *Workspace) evaluateAcrossModels(
 			defer wg.Done()
 			ctx, span := Tracer().Start(ctx, fmt.Sprintf("model: %s", model),
 				telemetry.Reveal())
-			report, err := New(w.Attempts, w.SystemPrompt).Evaluate(ctx, eval, model)
+			report, err := w.Evaluate(ctx, eval, model)
 			telemetry.End(span, func() error { return err })
 			if err != nil {
 				reports[i] = fmt.Sprintf("ERROR: %s", err)
@@ -199,11 +1685,33 @@ func (w *Workspace) evaluateAcrossModels(
 	return reports, nil
 }
 
+// Configure a single attempt of an evaluation with the model, system prompt,
+// and seed.
 func (w *Workspace) evaluate(model string, attempt int, evalFn EvalFunc) *dagger.EvalsReport {
-	return evalFn(
-		dag.Evals().
-			WithModel(model).
-			WithAttempt(attempt + 1).
-			WithSystemPrompt(w.SystemPrompt),
-	)
+	suite := dag.Evals().
+		WithModel(model).
+		WithAttempt(attempt + 1).
+		WithSystemPrompt(w.systemPrompt())
+	if w.Seed != 0 {
+		suite = suite.WithSeed(w.Seed)
+	}
+	return evalFn(suite)
+}
+
+// The system prompt to evaluate with, followed by any few-shot examples.
+func (w *Workspace) systemPrompt() string {
+	if len(w.FewShotExamples) == 0 {
+		return w.SystemPrompt
+	}
+	prompt := new(strings.Builder)
+	if w.SystemPrompt != "" {
+		fmt.Fprintln(prompt, w.SystemPrompt)
+		fmt.Fprintln(prompt)
+	}
+	fmt.Fprintln(prompt, "Here are some example exchanges:")
+	for i, example := range w.FewShotExamples {
+		fmt.Fprintln(prompt)
+		fmt.Fprintf(prompt, "<example number=\"%d\">\n%s\n</example>\n", i+1, example)
+	}
+	return prompt.String()
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestTally(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		succeeded   []bool
+		completed   []bool
+		successes   int
+		completions int
+	}{
+		{"none", nil, nil, 0, 0},
+		{"all succeeded", []bool{true, true, true}, []bool{true, true, true}, 3, 3},
+		{"mixed", []bool{true, false, true, false}, []bool{true, true, true, true}, 2, 4},
+		{"stopped early", []bool{true, false, false}, []bool{true, false, false}, 1, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			successes, completions := tally(test.succeeded, test.completed)
+			if successes != test.successes || completions != test.completions {
+				t.Errorf("got %d/%d, want %d/%d", successes, completions, test.successes, test.completions)
+			}
+		})
+	}
+}
+
+// Returns an outcome function that passes or fails each attempt as mocked,
+// without calling a model.
+func mockOutcomes(mocked []bool) outcomeFunc {
+	return func(ctx context.Context, name, model string, attempt int, evalFn EvalFunc) (*recording, error) {
+		if mocked[attempt] {
+			return &recording{Report: "passed", Succeeded: true}, nil
+		}
+		return &recording{Report: "failed"}, nil
+	}
+}
+
+func TestRunAttempts(t *testing.T) {
+	mixed := []bool{true, false, true, true, false, true, false, true}
+	allFail := []bool{false, false, false, false}
+	allPass := []bool{true, true, true, true}
+	for _, test := range []struct {
+		name        string
+		mocked      []bool
+		concurrency int
+		failFast    bool
+		passFast    bool
+		successes   int
+		completions int
+	}{
+		{"parallel", mixed, 0, false, false, 5, 8},
+		{"limited concurrency", mixed, 3, false, false, 5, 8},
+		{"sequential", mixed, 1, false, false, 5, 8},
+		{"fail fast", allFail, 1, true, false, 0, 1},
+		{"pass fast", allPass, 1, false, true, 1, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// repeat to shake out races between attempts
+			for range 50 {
+				w := &Workspace{
+					Attempts:       len(test.mocked),
+					MaxConcurrency: test.concurrency,
+					FailFast:       test.failFast,
+					PassFast:       test.passFast,
+					outcome:        mockOutcomes(test.mocked),
+				}
+				run, err := w.runAttempts(context.Background(), "Basic", "test-model")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if run.SuccessCount != test.successes || run.CompletedCount != test.completions {
+					t.Fatalf("got %d/%d, want %d/%d", run.SuccessCount, run.CompletedCount, test.successes, test.completions)
+				}
+				if skipped := len(test.mocked) - test.completions; run.Skipped() != skipped {
+					t.Fatalf("got %d skipped, want %d", run.Skipped(), skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestRunAttemptsCountsErrorsAsFailures(t *testing.T) {
+	w := &Workspace{
+		Attempts: 3,
+		outcome: func(ctx context.Context, name, model string, attempt int, evalFn EvalFunc) (*recording, error) {
+			if attempt == 1 {
+				return nil, errors.New("model unavailable")
+			}
+			return &recording{Report: "passed", Succeeded: true}, nil
+		},
+	}
+	run, err := w.runAttempts(context.Background(), "Basic", "test-model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.SuccessCount != 2 || run.CompletedCount != 3 {
+		t.Errorf("got %d/%d, want 2/3", run.SuccessCount, run.CompletedCount)
+	}
+}
+
+func TestRunAttemptsFailsWithoutRecording(t *testing.T) {
+	w := &Workspace{
+		Attempts: 3,
+		Replay:   replayReplay,
+		outcome: func(ctx context.Context, name, model string, attempt int, evalFn EvalFunc) (*recording, error) {
+			if attempt == 2 {
+				return nil, fmt.Errorf("%w for %s attempt %d with model %q", errNoRecording, name, attempt+1, model)
+			}
+			return &recording{Report: "passed", Succeeded: true}, nil
+		},
+	}
+	_, err := w.runAttempts(context.Background(), "Basic", "test-model")
+	if !errors.Is(err, errNoRecording) {
+		t.Fatalf("got error %v, want %v", err, errNoRecording)
+	}
+}
+
+func TestWithEval(t *testing.T) {
+	w := New(2, "")
+	for _, name := range []string{"Basic", "UndoChanges", "Basic", "UndoChanges", "Basic"} {
+		var err error
+		w, err = w.WithEval(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := w.EvalNames(), []string{"Basic", "UndoChanges"}; !slices.Equal(got, want) {
+		t.Errorf("got evals %v, want %v", got, want)
+	}
+
+	if _, err := w.WithEval("Unknown"); err == nil {
+		t.Error("expected an error for an unknown eval")
+	}
+}
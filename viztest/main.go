@@ -2,12 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"dagger/viztest/internal/dagger"
+	"dagger/viztest/internal/telemetry"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Viztest struct {
@@ -19,11 +31,18 @@ func (m *Viztest) HelloWorld() string {
 	return "Hello, world!"
 }
 
-// LogThroughput logs the current time in a tight loop.
-func (m *Viztest) Spam() *dagger.Container {
-	for {
-		fmt.Println(time.Now())
-	}
+// Spam returns a container that logs the current time in a tight loop,
+// optionally sleeping between lines.
+func (m *Viztest) Spam(
+	// +optional
+	// +default=0
+	delayMs int,
+) *dagger.Container {
+	return dag.Container().
+		From("alpine").
+		WithExec([]string{"sh", "-c",
+			`while true; do date; [ "$0" = 0 ] || sleep "$0"; done`,
+			fmt.Sprintf("%g", float64(delayMs)/1000)})
 }
 
 // Encapsulate calls a failing function, but ultimately succeeds.
@@ -50,6 +69,19 @@ func (*Viztest) Terminal() *dagger.Container {
 		Terminal()
 }
 
+// InteractiveShell attaches an interactive shell, and once it exits, runs one
+// more command to show that the pipeline carries on afterwards.
+func (*Viztest) InteractiveShell(ctx context.Context) (string, error) {
+	return dag.Container().
+		From("alpine").
+		WithEnvVariable("NOW", time.Now().String()).
+		Terminal(dagger.ContainerTerminalOpts{
+			Cmd: []string{"sh", "-l"},
+		}).
+		WithExec([]string{"echo", "shell exited cleanly"}).
+		Stdout(ctx)
+}
+
 func (*Viztest) PrimaryLines(n int) string {
 	buf := new(strings.Builder)
 	for i := 1; i <= n; i++ {
@@ -58,12 +90,235 @@ func (*Viztest) PrimaryLines(n int) string {
 	return buf.String()
 }
 
+// ReturnJSON returns a JSON object nested depth levels deep, with a very long
+// string at each level, to test how structured results are displayed.
+func (*Viztest) ReturnJSON(
+	ctx context.Context,
+	// +optional
+	// +default=5
+	depth int,
+) (string, error) {
+	var obj map[string]any
+	for level := depth; level >= 1; level-- {
+		obj = map[string]any{
+			"level":       level,
+			"tags":        []string{"alpha", "beta", "gamma"},
+			"description": strings.Repeat(fmt.Sprintf("level %d is very long. ", level), 50),
+			"child":       obj,
+		}
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// MarkdownResult returns a string full of Markdown, to see whether results are
+// rendered or shown raw.
+func (*Viztest) MarkdownResult() string {
+	fence := "```"
+	return `# Markdown Result
+
+Some **bold**, _italic_, and ` + "`inline code`" + ` text, plus a [link](https://dagger.io).
+
+## Lists
+
+- one
+- two
+  - two and a half
+- three
+
+1. first
+2. second
+
+## Table
+
+| Name  | Value |
+| ----- | ----: |
+| alpha |     1 |
+| beta  |    22 |
+
+## Code
+
+` + fence + `go
+func main() {
+	for i := 0; i < 3; i++ {
+		fmt.Println("whitespace   should   be   preserved")
+	}
+}
+` + fence + `
+
+A fence containing backticks:
+
+~~~~markdown
+` + fence + `sh
+echo "nested fence"
+` + fence + `
+~~~~
+`
+}
+
+// SeverityLogs emits one log record at each of the debug, info, warn, and error
+// levels.
+func (*Viztest) SeverityLogs(ctx context.Context) {
+	for _, severity := range []log.Severity{
+		log.SeverityDebug,
+		log.SeverityInfo,
+		log.SeverityWarn,
+		log.SeverityError,
+	} {
+		logAt(ctx, severity, fmt.Sprintf("This is a %s message", severityText[severity]))
+	}
+}
+
+// EscalatingLogs emits log records that escalate from debug through info and
+// warn to error as they progress.
+func (*Viztest) EscalatingLogs(
+	ctx context.Context,
+	// +optional
+	// +default=20
+	lines int,
+) {
+	levels := []log.Severity{
+		log.SeverityDebug,
+		log.SeverityInfo,
+		log.SeverityWarn,
+		log.SeverityError,
+	}
+	for i := 0; i < lines; i++ {
+		level := levels[i*len(levels)/lines]
+		logAt(ctx, level, fmt.Sprintf("This is line %d of %d", i+1, lines))
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// ManyResults returns a list of distinct strings, for testing how large list
+// results are rendered.
+func (*Viztest) ManyResults(count int) ([]string, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("count must not be negative, got %d", count)
+	}
+	results := make([]string, count)
+	for i := range results {
+		results[i] = fmt.Sprintf("This is result %d of %d", i+1, count)
+	}
+	return results, nil
+}
+
+// ProgressBar redraws a single progress line in place using carriage returns,
+// like docker pull or apt do.
+func (*Viztest) ProgressBar(
+	ctx context.Context,
+	// +optional
+	// +default=20
+	steps int,
+	// +optional
+	// +default=100
+	delayMs int,
+) {
+	const width = 40
+	for i := 0; i <= steps; i++ {
+		done := width * i / max(steps, 1)
+		fmt.Printf("\r[%s%s] %3d%%",
+			strings.Repeat("#", done),
+			strings.Repeat(" ", width-done),
+			100*i/max(steps, 1))
+		time.Sleep(time.Duration(delayMs) * time.Millisecond)
+	}
+	fmt.Println()
+}
+
+// ColoredLogs prints lines styled with raw ANSI escape sequences, ending with a
+// color that is never reset to see whether it bleeds into later output.
+func (*Viztest) ColoredLogs(ctx context.Context) {
+	for _, line := range []string{
+		"\x1b[31mred foreground\x1b[0m",
+		"\x1b[32mgreen foreground\x1b[0m",
+		"\x1b[33myellow foreground\x1b[0m",
+		"\x1b[34mblue foreground\x1b[0m",
+		"\x1b[35mmagenta foreground\x1b[0m",
+		"\x1b[36mcyan foreground\x1b[0m",
+		"\x1b[41;37mwhite on red background\x1b[0m",
+		"\x1b[44;37mwhite on blue background\x1b[0m",
+		"\x1b[1mbold\x1b[0m",
+		"\x1b[4munderline\x1b[0m",
+		"\x1b[1;4;33mbold underlined yellow\x1b[0m",
+		"plain text after styled text",
+		"\x1b[35mmagenta that is never reset",
+		"is this line still magenta?",
+	} {
+		fmt.Println(line)
+	}
+}
+
+// Emoji prints lines and creates spans containing emoji, combining characters,
+// and CJK text, to catch wide-character alignment bugs.
+func (*Viztest) Emoji(ctx context.Context) {
+	for _, text := range []string{
+		"simple emoji: 🚀 🐳 ✅ ❌",
+		"zero-width joiner: 👩‍💻 👨‍👩‍👧‍👦 🏳️‍🌈",
+		"skin tone modifier: 👍🏽 👋🏿",
+		"combining characters: e\u0301 n\u0303 a\u030a",
+		"CJK: 你好，世界 こんにちは 안녕하세요",
+		"mixed: 🚀 启动 done ✅",
+	} {
+		fmt.Println(text)
+		_, span := Tracer().Start(ctx, text)
+		span.End()
+	}
+}
+
 func (*Viztest) ManyLines(n int) {
 	for i := 1; i <= n; i++ {
 		fmt.Println("This is line", i, "of", n)
 	}
 }
 
+// SlowLogs prints one character at a time with a delay between each, only
+// ending the line once every character is printed, to test how partial lines
+// are buffered and flushed.
+func (*Viztest) SlowLogs(
+	ctx context.Context,
+	// +optional
+	// +default=100
+	chars int,
+	// +optional
+	// +default=100
+	delayMs int,
+) {
+	defer fmt.Println()
+	alphabet := "abcdefghijklmnopqrstuvwxyz"
+	for i := 0; i < chars; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(delayMs) * time.Millisecond):
+		}
+		fmt.Print(string(alphabet[i%len(alphabet)]))
+	}
+}
+
+// BackpressureTest writes a burst of lines as fast as possible and reports how
+// long the writes took to return, to see whether the telemetry pipeline
+// throttles fast producers.
+func (*Viztest) BackpressureTest(
+	// +optional
+	// +default=100000
+	burstLines int,
+) {
+	var slowest time.Duration
+	start := time.Now()
+	for i := 1; i <= burstLines; i++ {
+		writeStart := time.Now()
+		fmt.Println("This is burst line", i, "of", burstLines)
+		slowest = max(slowest, time.Since(writeStart))
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("Wrote %d lines in %s (%.f lines/sec, slowest write: %s)\n",
+		burstLines, elapsed, float64(burstLines)/elapsed.Seconds(), slowest)
+}
+
 func (vt *Viztest) ManySpans(
 	ctx context.Context,
 	n int,
@@ -77,6 +332,206 @@ func (vt *Viztest) ManySpans(
 	}
 }
 
+// NestedSpans creates a chain of spans, each a child of the previous one, and
+// ends them from the deepest level up.
+func (vt *Viztest) NestedSpans(
+	ctx context.Context,
+	depth int,
+	// +default=0
+	delayMs int,
+) {
+	nestSpans(ctx, 1, depth, time.Duration(delayMs)*time.Millisecond)
+}
+
+func nestSpans(ctx context.Context, level, depth int, delay time.Duration) {
+	if level > depth {
+		return
+	}
+	ctx, span := Tracer().Start(ctx, fmt.Sprintf("level %d", level))
+	defer span.End()
+	time.Sleep(delay)
+	nestSpans(ctx, level+1, depth, delay)
+}
+
+// SpanEvents adds a series of timestamped events to a single span.
+func (*Viztest) SpanEvents(
+	ctx context.Context,
+	// +optional
+	// +default=5
+	count int,
+	// +optional
+	// +default=500
+	delayMs int,
+) {
+	_, span := Tracer().Start(ctx, "span with events")
+	defer span.End()
+	for i := 1; i <= count; i++ {
+		span.AddEvent(fmt.Sprintf("event %d", i),
+			trace.WithAttributes(attribute.Int("viztest.event", i)))
+		time.Sleep(time.Duration(delayMs) * time.Millisecond)
+	}
+}
+
+// Fanout runs many short containers in parallel, each under its own span.
+func (*Viztest) Fanout(
+	ctx context.Context,
+	// +optional
+	// +default=20
+	width int,
+) error {
+	if width < 0 {
+		return fmt.Errorf("width must not be negative, got %d", width)
+	}
+	errs := make([]error, width)
+	wg := new(sync.WaitGroup)
+	for i := 1; i <= width; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("branch %d", i))
+			defer span.End()
+			_, err := dag.Container().
+				From("alpine").
+				WithEnvVariable("NOW", time.Now().String()).
+				WithExec([]string{"sh", "-c", `echo "branch $0 working"; sleep 2`,
+					fmt.Sprint(i)}).
+				Sync(ctx)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
+			errs[i-1] = err
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// HighCardinalitySpans creates spans that each carry a unique attribute value.
+func (*Viztest) HighCardinalitySpans(ctx context.Context, count int) {
+	for i := 1; i <= count; i++ {
+		_, span := Tracer().Start(ctx, fmt.Sprintf("span %d", i),
+			trace.WithAttributes(attribute.String("viztest.id", uuid.NewString())))
+		span.End()
+	}
+}
+
+// ParentEndsFirst ends a span while its children are still running. Each child
+// ends a second after the previous one.
+func (*Viztest) ParentEndsFirst(
+	ctx context.Context,
+	// +optional
+	// +default=3
+	children int,
+) {
+	ctx, parent := Tracer().Start(ctx, "parent")
+	wg := new(sync.WaitGroup)
+	for i := 1; i <= children; i++ {
+		_, child := Tracer().Start(ctx, fmt.Sprintf("child %d", i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * time.Second)
+			child.End()
+		}(i)
+	}
+	time.Sleep(500 * time.Millisecond)
+	parent.End()
+	wg.Wait()
+}
+
+// OrphanSpan starts a child span in a goroutine and returns once its parent
+// has ended, without waiting for the child, which ends a couple of seconds
+// later (if the module is still running by then).
+func (*Viztest) OrphanSpan(ctx context.Context) {
+	ctx, parent := Tracer().Start(ctx, "parent")
+	started := make(chan struct{})
+	go func() {
+		_, child := Tracer().Start(ctx, "orphaned child")
+		close(started)
+		time.Sleep(2 * time.Second)
+		child.End()
+	}()
+	<-started
+	parent.End()
+}
+
+// RecordedException records an exception event with a stack trace on a span
+// that ends with an error status, followed by a span that records an exception
+// but still ends OK.
+func (*Viztest) RecordedException(ctx context.Context) {
+	_, span := Tracer().Start(ctx, "exception with error status")
+	err := errors.New("something went terribly wrong")
+	span.RecordError(err, trace.WithStackTrace(true))
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+
+	_, span = Tracer().Start(ctx, "exception with ok status")
+	span.RecordError(errors.New("something went wrong, but it was handled"),
+		trace.WithStackTrace(true))
+	span.SetStatus(codes.Ok, "")
+	span.End()
+}
+
+// AttachmentLogs produces a file and an image and logs clearly-labeled
+// references to them, for testing how the UI presents artifacts.
+func (*Viztest) AttachmentLogs(ctx context.Context) error {
+	report := dag.Container().
+		From("alpine").
+		WithEnvVariable("NOW", time.Now().String()).
+		WithExec([]string{"sh", "-c", "date > /report.txt"}).
+		File("/report.txt")
+	size, err := report.Size(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[artifact] file: /report.txt (%d bytes)\n", size)
+
+	image, err := dag.Container().From("alpine").ImageRef(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[artifact] image: %s\n", image)
+
+	fmt.Println("[artifact] link: https://dagger.io")
+	return nil
+}
+
+// Throughput reports a bytes-processed counter metric every second for the
+// given duration, to see whether metrics show up alongside spans.
+func (*Viztest) Throughput(
+	ctx context.Context,
+	// +optional
+	// +default=30
+	seconds int,
+) error {
+	processed, err := telemetry.Meter(ctx, "viztest").Int64Counter("viztest.bytes_processed",
+		metric.WithUnit("By"),
+		metric.WithDescription("Bytes processed by Throughput."))
+	if err != nil {
+		return err
+	}
+
+	// correlate the metric with the calling span
+	spanCtx := trace.SpanContextFromContext(ctx)
+	attrs := metric.WithAttributes(
+		attribute.String(telemetry.MetricsSpanIDAttr, spanCtx.SpanID().String()),
+		attribute.String(telemetry.MetricsTraceIDAttr, spanCtx.TraceID().String()))
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for i := 1; i <= seconds; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		n := rand.Int63n(10 << 20)
+		processed.Add(ctx, n, attrs)
+		fmt.Printf("%d: processed %d bytes\n", i, n)
+	}
+	return nil
+}
+
 // Continuously prints batches of logs on an interval (default 1 per second).
 func (*Viztest) StreamingLogs(
 	ctx context.Context,
@@ -127,6 +582,35 @@ func (*Viztest) StreamingChunks(
 	}
 }
 
+// Cancellable works for the given amount of time, and if it is cancelled
+// before then, cleans up in its own span and returns a partial result.
+func (*Viztest) Cancellable(
+	ctx context.Context,
+	// +optional
+	// +default=60000
+	afterMs int,
+) (string, error) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	done := time.After(time.Duration(afterMs) * time.Millisecond)
+	steps := 0
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("cancelled; cleaning up")
+			_, span := Tracer().Start(context.WithoutCancel(ctx), "cleanup")
+			time.Sleep(time.Second)
+			span.End()
+			return fmt.Sprintf("partial result: completed %d steps", steps), nil
+		case <-done:
+			return fmt.Sprintf("completed %d steps", steps), nil
+		case <-ticker.C:
+			steps++
+			fmt.Println("completed step", steps)
+		}
+	}
+}
+
 func (*Viztest) Echo(ctx context.Context, message string) (string, error) {
 	return dag.Container().
 		From("alpine").
@@ -163,6 +647,81 @@ func (*Viztest) Accounting(ctx context.Context) *dagger.Container {
 		WithExec([]string{"sleep", "2"})
 }
 
+// maxLargeFileMegabytes caps LargeFile to avoid accidentally filling up disk
+// or memory.
+const maxLargeFileMegabytes = 4096
+
+// LargeFile returns a file of random bytes of the given size.
+func (*Viztest) LargeFile(
+	// +optional
+	// +default=100
+	megabytes int,
+) (*dagger.File, error) {
+	if megabytes < 1 || megabytes > maxLargeFileMegabytes {
+		return nil, fmt.Errorf("megabytes must be between 1 and %d", maxLargeFileMegabytes)
+	}
+	return dag.Container().
+		From("alpine").
+		WithEnvVariable("NOW", time.Now().String()).
+		WithExec([]string{"dd", "if=/dev/urandom", "of=/large.bin", "bs=1M",
+			fmt.Sprintf("count=%d", megabytes)}).
+		File("/large.bin"), nil
+}
+
+// NestedDir returns a directory tree depth levels deep, with breadth files and
+// breadth subdirectories at each level, to exercise how large directory results
+// are summarized.
+func (*Viztest) NestedDir(
+	ctx context.Context,
+	// +default=4
+	depth int,
+	// +default=4
+	breadth int,
+) *dagger.Directory {
+	return nestedDir(1, depth, breadth)
+}
+
+func nestedDir(level, depth, breadth int) *dagger.Directory {
+	var sub *dagger.Directory
+	if level < depth {
+		sub = nestedDir(level+1, depth, breadth)
+	}
+	dir := dag.Directory()
+	for i := 1; i <= breadth; i++ {
+		dir = dir.WithNewFile(fmt.Sprintf("file-%d.txt", i),
+			strings.Repeat(fmt.Sprintf("This is file %d at level %d.\n", i, level), 100))
+		if sub != nil {
+			dir = dir.WithDirectory(fmt.Sprintf("dir-%d", i), sub)
+		}
+	}
+	return dir
+}
+
+// SlowStart configures a slow step at the start of a long chain of quick
+// dependent steps, and only syncs once the whole chain is built, like
+// Accounting but with the slow step much further from where it's forced.
+func (*Viztest) SlowStart(
+	ctx context.Context,
+	// +optional
+	// +default=10
+	chain int,
+) error {
+	ctr := slowStep(dag.Container().
+		From("alpine").
+		WithEnvVariable("NOW", time.Now().String()))
+	for i := 1; i <= chain; i++ {
+		ctr = ctr.WithExec([]string{"sh", "-c", `echo "quick step $0"; sleep 0.1`,
+			fmt.Sprint(i)})
+	}
+	_, err := ctr.Sync(ctx)
+	return err
+}
+
+// slowStep adds the slow step to SlowStart's chain.
+func slowStep(ctr *dagger.Container) *dagger.Container {
+	return ctr.WithExec([]string{"sh", "-c", "echo 'the slow step'; sleep 5"})
+}
+
 // DeepSleep sleeps forever.
 func (*Viztest) DeepSleep(ctx context.Context) *dagger.Container {
 	return dag.Container().
@@ -192,6 +751,22 @@ func (*Viztest) LogStderr() {
 	fmt.Fprintln(os.Stderr, "Hello, world!")
 }
 
+// InterleavedStreams alternates between writing to stdout and stderr as fast as
+// possible, numbering each line so out-of-order rendering is easy to spot.
+func (*Viztest) InterleavedStreams(
+	// +optional
+	// +default=100
+	lines int,
+) {
+	for i := 1; i <= lines; i++ {
+		if i%2 == 1 {
+			fmt.Fprintln(os.Stdout, i, "stdout")
+		} else {
+			fmt.Fprintln(os.Stderr, i, "stderr")
+		}
+	}
+}
+
 // Fail fails after waiting for a certain amount of time.
 func (*Viztest) FailLog(ctx context.Context) error {
 	_, err := dag.Container().
@@ -202,6 +777,81 @@ func (*Viztest) FailLog(ctx context.Context) error {
 	return err
 }
 
+// Panic logs a line and then panics, to see how a panic in module code is
+// surfaced, as opposed to a failing container.
+//
+// The panic is recorded on a span before being re-raised, so that its message
+// is visible even if the call itself only reports a generic error.
+func (*Viztest) Panic(ctx context.Context) {
+	fmt.Println("about to panic")
+	_, span := Tracer().Start(ctx, "panicking")
+	defer func() {
+		if r := recover(); r != nil {
+			span.SetStatus(codes.Error, fmt.Sprint(r))
+			span.End()
+			panic(r)
+		}
+	}()
+	panic("viztest: deliberate panic to test how the UI surfaces it")
+}
+
+// ExitCode runs a container that exits with the given code.
+func (*Viztest) ExitCode(ctx context.Context, code int) error {
+	_, err := dag.Container().
+		From("alpine").
+		WithEnvVariable("NOW", time.Now().String()).
+		WithExec([]string{"sh", "-c", `exit "$0"`, fmt.Sprint(code)}).
+		Sync(ctx)
+	return err
+}
+
+// LeakSecret runs a container that echoes a secret's plaintext alongside a
+// regular string, to check that the secret is redacted in the logs.
+func (*Viztest) LeakSecret(ctx context.Context, secret *dagger.Secret) error {
+	_, err := dag.Container().
+		From("alpine").
+		WithEnvVariable("NOW", time.Now().String()).
+		WithSecretVariable("SECRET", secret).
+		WithExec([]string{"sh", "-c", `echo "this is not a secret"; echo "the secret is: $SECRET"`}).
+		Sync(ctx)
+	return err
+}
+
+// Retry runs a container that fails the given number of times before it
+// succeeds, with each attempt in its own span.
+func (*Viztest) Retry(
+	ctx context.Context,
+	// +optional
+	// +default=2
+	failures int,
+) error {
+	for attempt := 1; ; attempt++ {
+		err := func() (rerr error) {
+			ctx, span := Tracer().Start(ctx, fmt.Sprintf("attempt %d", attempt))
+			defer func() {
+				if rerr != nil {
+					span.SetStatus(codes.Error, rerr.Error())
+				}
+				span.End()
+			}()
+			_, err := dag.Container().
+				From("alpine").
+				WithEnvVariable("NOW", time.Now().String()).
+				WithExec([]string{"sh", "-c",
+					`echo "attempt $0"; [ "$0" -gt "$1" ] || { echo failing; exit 1; }`,
+					fmt.Sprint(attempt), fmt.Sprint(failures)}).
+				Sync(ctx)
+			return err
+		}()
+		if err == nil {
+			return nil
+		}
+		if attempt > failures {
+			return err
+		}
+	}
+}
+
 // Fail fails after waiting for a certain amount of time.
 func (*Viztest) Fail(ctx context.Context,
 	// +optional
@@ -253,6 +903,109 @@ func (v *Viztest) UseNoExecService(ctx context.Context) (string, error) {
 		Stdout(ctx)
 }
 
+// FlakyService returns a service that never becomes healthy. With the "exit"
+// failure mode its process exits after a few seconds, and with "no-listen" it
+// runs forever without listening on its exposed port.
+func (*Viztest) FlakyService(
+	// +optional
+	// +default="exit"
+	failure string,
+) (*dagger.Service, error) {
+	var cmd string
+	switch failure {
+	case "exit":
+		cmd = "echo starting up; sleep 3; echo crashing; exit 1"
+	case "no-listen":
+		cmd = "echo starting up; sleep infinity"
+	default:
+		return nil, fmt.Errorf("unknown failure mode %q (expected exit or no-listen)", failure)
+	}
+	return dag.Container().
+		From("alpine").
+		WithExposedPort(8000).
+		WithExec([]string{"sh", "-c", cmd}).
+		AsService(), nil
+}
+
+// MultipleServices returns HTTP servers on distinct ports, each logging its
+// startup.
+func (*Viztest) MultipleServices(count int) ([]*dagger.Service, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("count must not be negative, got %d", count)
+	}
+	svcs := make([]*dagger.Service, count)
+	for i := range svcs {
+		port := 8000 + i
+		svcs[i] = dag.Container().
+			From("python").
+			WithExposedPort(port).
+			WithExec([]string{"sh", "-c",
+				`echo "service $0 starting on port $1"; exec python -m http.server "$1"`,
+				fmt.Sprint(i + 1), fmt.Sprint(port)}).
+			AsService()
+	}
+	return svcs, nil
+}
+
+// BusyServiceThenStop starts a service that never responds, sends it several
+// concurrent requests, and stops the service while they are still in flight.
+func (*Viztest) BusyServiceThenStop(
+	ctx context.Context,
+	// +optional
+	// +default=5
+	requests int,
+) error {
+	svc, err := dag.Container().
+		From("python").
+		WithExposedPort(8000).
+		WithExec([]string{"python", "-c", `
+import http.server, time
+
+class Handler(http.server.BaseHTTPRequestHandler):
+    def do_GET(self):
+        time.sleep(3600)
+
+http.server.ThreadingHTTPServer(("", 8000), Handler).serve_forever()
+`}).
+		AsService().
+		Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := new(sync.WaitGroup)
+	for i := 1; i <= requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := dag.Container().
+				From("alpine").
+				WithServiceBinding("busy", svc).
+				WithEnvVariable("REQUEST", fmt.Sprint(i)).
+				WithEnvVariable("NOW", time.Now().String()).
+				WithExec([]string{"wget", "-O-", "http://busy:8000"}).
+				Sync(reqCtx)
+			fmt.Println("request", i, "finished:", err)
+		}(i)
+	}
+
+	// give the requests time to get in flight
+	time.Sleep(5 * time.Second)
+
+	fmt.Println("stopping service with", requests, "requests in flight")
+	if _, err := svc.Stop(ctx); err != nil {
+		return err
+	}
+
+	// anything still hanging after the service stops is abandoned
+	time.AfterFunc(10*time.Second, cancel)
+	wg.Wait()
+	return nil
+}
+
 func (*Viztest) Pending(ctx context.Context) error {
 	_, err := dag.Container().
 		From("alpine").
@@ -270,6 +1023,28 @@ func (*Viztest) Pending(ctx context.Context) error {
 	return err
 }
 
+// CacheFlap runs independent steps that are cached for different durations,
+// so running it several times in a row flips individual steps between cached
+// and fresh.
+func (*Viztest) CacheFlap(ctx context.Context) error {
+	now := time.Now()
+	for _, step := range []string{
+		"im cached for good",
+		"im cached every minute: " + now.Truncate(time.Minute).String(),
+		"im cached every 10 seconds: " + now.Truncate(10*time.Second).String(),
+		"im busted every call: " + now.String(),
+	} {
+		_, err := dag.Container().
+			From("alpine").
+			WithExec([]string{"echo", step}).
+			Sync(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (*Viztest) Colors16(ctx context.Context) (string, error) {
 	src := dag.Git("https://gitlab.com/dwt1/shell-color-scripts").
 		Branch("master").
@@ -297,3 +1072,20 @@ func (*Viztest) Colors256(ctx context.Context) (string, error) {
 		WithExec([]string{"pokemon-colorscripts", "-r", "1"}).
 		Stdout(ctx)
 }
+
+var severityText = map[log.Severity]string{
+	log.SeverityDebug: "DEBUG",
+	log.SeverityInfo:  "INFO",
+	log.SeverityWarn:  "WARN",
+	log.SeverityError: "ERROR",
+}
+
+// logAt emits a log record with the given severity.
+func logAt(ctx context.Context, severity log.Severity, msg string) {
+	var rec log.Record
+	rec.SetTimestamp(time.Now())
+	rec.SetSeverity(severity)
+	rec.SetSeverityText(severityText[severity])
+	rec.SetBody(log.StringValue(msg))
+	telemetry.Logger(ctx, "viztest").Emit(ctx, rec)
+}